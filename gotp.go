@@ -6,12 +6,17 @@ package gotp
 
 import (
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
 	"encoding/base32"
 	"errors"
 	"fmt"
+	"hash"
 	"math"
-	"math/rand"
+	mathrand "math/rand"
 	"strings"
 	"time"
 )
@@ -30,14 +35,86 @@ var (
 
 // runeCharacters is a slice of available runes for secret generation.
 // This var is not modifiable outside of the library.
+//
+// Deprecated: only used by NewTokenFromRunes, which is itself deprecated.
 var runeCharacters = []rune("1234567890ABCDEFGHIJKLMNOPQRSTUVWXYZ")
 
+// Algorithm identifies the HMAC hash function a Token uses to generate OTPs.
+type Algorithm int
+
+const (
+	// AlgorithmSHA1 is the default algorithm per RFC4226/RFC6238, and the
+	// only one most authenticator apps support.
+	AlgorithmSHA1 Algorithm = iota
+	// AlgorithmSHA256 uses HMAC-SHA256, as supported by some authenticators
+	// that negotiate stronger secrets.
+	AlgorithmSHA256
+	// AlgorithmSHA512 uses HMAC-SHA512.
+	AlgorithmSHA512
+)
+
+// hashFunc returns the hash constructor for the algorithm, defaulting to
+// SHA1 for the zero value and any unrecognized value.
+func (a Algorithm) hashFunc() func() hash.Hash {
+	switch a {
+	case AlgorithmSHA256:
+		return sha256.New
+	case AlgorithmSHA512:
+		return sha512.New
+	default:
+		return sha1.New
+	}
+}
+
+// TokenConfig customizes the algorithm and digit count a Token is
+// constructed with. The zero value selects AlgorithmSHA1 and TokenLength
+// digits, matching the library's long-standing defaults.
+type TokenConfig struct {
+	Algorithm Algorithm
+	Digits    int
+}
+
+// resolveTokenConfig applies TokenConfig defaults without mutating any
+// package-level state, so concurrently constructed Tokens can't race on
+// each other's settings.
+func resolveTokenConfig(config []TokenConfig) (TokenConfig, error) {
+	cfg := TokenConfig{}
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	if cfg.Digits == 0 {
+		cfg.Digits = TokenLength
+	}
+
+	if cfg.Digits < 6 || cfg.Digits > 8 {
+		return cfg, errors.New("Digits must be between 6 and 8.")
+	}
+
+	return cfg, nil
+}
+
 // Token is the core one-time password struct.
 // It is naive, and does not store information about its counter step to
 // facilitate simple construction of time-based one-time password.
+//
+// Counter is only used by the HOTP (RFC4226) methods, GenerateHOTP and
+// VerifyHOTP. TOTP generation derives its own counter from the current time
+// and ignores this field.
 type Token struct {
-	Seed   []byte
-	Base32 string
+	Seed      []byte
+	Base32    string
+	Counter   int64
+	Algorithm Algorithm
+	Digits    int
+
+	// ID identifies this token to ReplayGuard. ReplayGuard is consulted
+	// whenever it is set, whatever ID holds; tokens sharing a ReplayGuard
+	// under the same ID (including the empty ID) share one last step.
+	ID string
+	// ReplayGuard, if set, is consulted by VerifyChallengeAt to reject a
+	// previously verified OTP. See ReplayGuard for details.
+	ReplayGuard ReplayGuard
 }
 
 // GenerateOTP generates a single six-digit OTP based on the OTP's seed and
@@ -52,10 +129,15 @@ func (t *Token) GenerateOTP(counterBytes []byte) (string, error) {
 	}
 
 	// Generate HMAC from counter factor.
-	hmacer := hmac.New(sha1.New, t.Seed)
+	hmacer := hmac.New(t.Algorithm.hashFunc(), t.Seed)
 	hmacer.Write(counterBytes)
 	hmac := hmacer.Sum(nil)
 
+	digits := t.Digits
+	if digits == 0 {
+		digits = TokenLength
+	}
+
 	// Generate OTP.
 	// Source: https://tools.ietf.org/html/rfc4226#section-5.4
 	offset := int(hmac[len(hmac)-1] & 0xF)
@@ -64,10 +146,10 @@ func (t *Token) GenerateOTP(counterBytes []byte) (string, error) {
 		((int(hmac[offset+2] & 0xFF)) << 8) |
 		(int(hmac[offset+3]) & 0xFF)
 
-	otp = otp % int(math.Pow10(TokenLength))
+	otp = otp % int(math.Pow10(digits))
 
 	// Left-pad with zeroes if the value is less than six characters long.
-	otpString := fmt.Sprintf(fmt.Sprintf("%%0%dd", TokenLength), otp)
+	otpString := fmt.Sprintf(fmt.Sprintf("%%0%dd", digits), otp)
 
 	return otpString, nil
 }
@@ -75,66 +157,183 @@ func (t *Token) GenerateOTP(counterBytes []byte) (string, error) {
 // GenerateTOTP generates an OTP value based on the `genTime` provided time.
 func (t *Token) GenerateTOTP(genTime int64) (string, error) {
 	timeStep := genTime / int64(StepSeconds)
-	timeBytes := make([]byte, 8)
-	for i := 7; i >= 0; i-- {
-		timeBytes[i] = byte(timeStep & 0xff)
-		timeStep = timeStep >> 8
+
+	return t.GenerateOTP(counterToBytes(timeStep))
+}
+
+// GenerateHOTP generates an OTP value based on the token's current counter,
+// per RFC4226, then advances the counter so the next call produces the next
+// code in the sequence.
+func (t *Token) GenerateHOTP() (string, error) {
+	otp, err := t.GenerateOTP(counterToBytes(t.Counter))
+	if err != nil {
+		return "", err
 	}
 
-	return t.GenerateOTP(timeBytes)
+	t.Counter++
+
+	return otp, nil
 }
 
-// VerifyChallenge verifies the `challenge` password.
-// If `drift` is true, it will verify the challenge against a 90-second window
-// of TOTP generation to protect against clock drift denial of service,
-// through no fault of the user.
-func (t *Token) VerifyChallenge(challenge string, drift bool) bool {
-	otps := []string{}
-	steps := []int{0}
+// VerifyHOTP verifies the `challenge` password against the token's counter.
+// To tolerate a client and server counter drifting out of sync (for example
+// when a user requests a code but never submits it), it tries `lookahead`
+// counters beyond the current one, per RFC4226's resynchronization
+// recommendation. On a match, the token's counter is advanced to one past
+// the matched counter, and the matched counter is returned so the caller can
+// persist it alongside the token.
+func (t *Token) VerifyHOTP(challenge string, lookahead int) (int64, bool, error) {
+	for i := 0; i <= lookahead; i++ {
+		counter := t.Counter + int64(i)
+
+		otp, err := t.GenerateOTP(counterToBytes(counter))
+		if err != nil {
+			return 0, false, err
+		}
 
-	if drift == true {
-		steps = append(steps, []int{(-1 * StepSeconds), StepSeconds}...)
+		if otp == challenge {
+			t.Counter = counter + 1
+			return counter, true, nil
+		}
 	}
 
-	for _, step := range steps {
-		genTime := time.Now().Unix() + int64(step)
+	return 0, false, nil
+}
+
+// counterToBytes serializes a counter to the 8-byte big-endian
+// representation expected by GenerateOTP.
+func counterToBytes(counter int64) []byte {
+	counterBytes := make([]byte, 8)
+	for i := 7; i >= 0; i-- {
+		counterBytes[i] = byte(counter & 0xff)
+		counter = counter >> 8
+	}
+
+	return counterBytes
+}
+
+// VerifyChallengeAt verifies the `challenge` password against TOTPs
+// generated for `backward` steps before and `forward` steps after `at`,
+// comparing each candidate to `challenge` in constant time, so a comparison
+// takes as long whether or not part of the candidate matches. The loop
+// stops at the first matching step, so the total time taken does depend on
+// which step matched. It returns whether a match was found
+// and, if so, the matched step offset relative to `at` (negative for a step
+// in the past, positive for the future) - useful for diagnosing client/server
+// clock skew or for rejecting replays by recording the last-seen step.
+//
+// If t.ReplayGuard is set, a match is only accepted if its absolute
+// time-step is strictly greater than the last step recorded for t.ID;
+// otherwise it fails with ErrReplay. This defeats replay of a previously
+// accepted OTP even though it remains valid for the rest of its step.
+func (t *Token) VerifyChallengeAt(challenge string, at time.Time, backward, forward int) (bool, int, error) {
+	for step := -backward; step <= forward; step++ {
+		genTime := at.Unix() + int64(step*StepSeconds)
+
 		otp, err := t.GenerateTOTP(genTime)
 		if err != nil {
-			return false
+			return false, 0, err
 		}
 
-		otps = append(otps, otp)
-	}
+		if subtle.ConstantTimeCompare([]byte(otp), []byte(challenge)) != 1 {
+			continue
+		}
 
-	for _, otp := range otps {
-		if otp == challenge {
-			return true
+		if t.ReplayGuard == nil {
+			return true, step, nil
 		}
+
+		timeStep := genTime / int64(StepSeconds)
+
+		lastStep, err := t.ReplayGuard.LastStep(t.ID)
+		if err != nil {
+			return false, 0, err
+		}
+
+		if timeStep <= lastStep {
+			return false, step, ErrReplay
+		}
+
+		if err := t.ReplayGuard.SetLastStep(t.ID, timeStep); err != nil {
+			return false, 0, err
+		}
+
+		return true, step, nil
 	}
 
-	return false
+	return false, 0, nil
+}
+
+// VerifyChallenge verifies the `challenge` password.
+// If `drift` is true, it will verify the challenge against a 90-second window
+// of TOTP generation to protect against clock drift denial of service,
+// through no fault of the user.
+func (t *Token) VerifyChallenge(challenge string, drift bool) bool {
+	backward, forward := 0, 0
+	if drift {
+		backward, forward = 1, 1
+	}
+
+	ok, _, err := t.VerifyChallengeAt(challenge, time.Now(), backward, forward)
+	if err != nil {
+		return false
+	}
+
+	return ok
 }
 
 // TokenFromBytes generates a new OTP from an existing seed.
-func TokenFromBytes(seedBytes []byte) (*Token, error) {
+//
+// An optional TokenConfig may be passed to select the HMAC algorithm and
+// digit count; the package defaults (SHA1, TokenLength digits) are used
+// otherwise.
+func TokenFromBytes(seedBytes []byte, config ...TokenConfig) (*Token, error) {
+	cfg, err := resolveTokenConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
 	token := &Token{
-		Seed:   seedBytes,
-		Base32: strings.ToUpper(base32.StdEncoding.EncodeToString(seedBytes)),
+		Seed:      seedBytes,
+		Base32:    strings.ToUpper(base32.StdEncoding.EncodeToString(seedBytes)),
+		Algorithm: cfg.Algorithm,
+		Digits:    cfg.Digits,
 	}
 
 	return token, nil
 }
 
-// NewToken generates a new OTP token with a random seed.
-func NewToken() (*Token, error) {
-	rand.Seed(time.Now().UnixNano())
+// NewToken generates a new OTP token with a random seed, read from
+// crypto/rand. The seed is arbitrary binary data; Base32 encoding for
+// transport or display is handled by TokenFromBytes.
+//
+// An optional TokenConfig may be passed to select the HMAC algorithm and
+// digit count; the package defaults (SHA1, TokenLength digits) are used
+// otherwise.
+func NewToken(config ...TokenConfig) (*Token, error) {
+	seedBytes := make([]byte, SeedLength)
+	if _, err := rand.Read(seedBytes); err != nil {
+		return nil, err
+	}
+
+	return TokenFromBytes(seedBytes, config...)
+}
+
+// NewTokenFromRunes generates a new OTP token with a seed drawn from a
+// restricted rune alphabet, using math/rand.
+//
+// Deprecated: this seed is predictable and unsuitable for a security
+// sensitive secret. Use NewToken instead, which sources its seed from
+// crypto/rand.
+func NewTokenFromRunes(config ...TokenConfig) (*Token, error) {
+	mathrand.Seed(time.Now().UnixNano())
 	seedRunes := make([]rune, SeedLength)
 
 	for i := range seedRunes {
-		seedRunes[i] = runeCharacters[rand.Intn(len(runeCharacters))]
+		seedRunes[i] = runeCharacters[mathrand.Intn(len(runeCharacters))]
 	}
 
 	seedBytes := []byte(string(seedRunes))
 
-	return TokenFromBytes(seedBytes)
+	return TokenFromBytes(seedBytes, config...)
 }
@@ -1,7 +1,9 @@
 package gotp
 
 import (
+	mathrand "math/rand"
 	"testing"
+	"time"
 )
 
 var (
@@ -23,6 +25,41 @@ func TestGenerate(t *testing.T) {
 	}
 }
 
+// Tests that two successive NewToken seeds differ with overwhelming
+// probability, and that NewToken does not draw from or reseed the global
+// math/rand PRNG.
+func TestNewTokenSeedsAreRandom(t *testing.T) {
+	tokenA, err := NewToken()
+	if err != nil {
+		t.Errorf("Token creation failed: %s", err.Error())
+	}
+
+	tokenB, err := NewToken()
+	if err != nil {
+		t.Errorf("Token creation failed: %s", err.Error())
+	}
+
+	if string(tokenA.Seed) == string(tokenB.Seed) {
+		t.Error("Two successive NewToken seeds were identical")
+	}
+
+	// If NewToken seeded or otherwise drew from the global math/rand source,
+	// calling it between two identically-seeded draws would change the
+	// second draw.
+	mathrand.Seed(1)
+	want := mathrand.Int63()
+
+	mathrand.Seed(1)
+	if _, err := NewToken(); err != nil {
+		t.Errorf("Token creation failed: %s", err.Error())
+	}
+	got := mathrand.Int63()
+
+	if got != want {
+		t.Error("NewToken appears to have consumed or reseeded the global math/rand source")
+	}
+}
+
 // Tests generating a new token and ensuring its generated base32 is correct.
 func TestGenerateBase32(t *testing.T) {
 	correctB32 := "IFBEGRCFIZDUQSKKJNGE2TSPKBIVEU2U"
@@ -55,3 +92,191 @@ func TestVerify(t *testing.T) {
 		t.Errorf("Generated OTP '%s' does not match test OTP '%s'", otp, correctOTP)
 	}
 }
+
+// Tests that VerifyChallengeAt matches the generated OTP at the exact step,
+// within a drift window on either side, and reports the correct matched
+// step offset.
+func TestVerifyChallengeAt(t *testing.T) {
+	correctOTP := "111782"
+
+	token, err := TokenFromBytes(testSeedBytes)
+	if err != nil {
+		t.Errorf("Token creation failed: %s", err.Error())
+	}
+
+	at := time.Unix(testTime, 0)
+
+	ok, step, err := token.VerifyChallengeAt(correctOTP, at, 0, 0)
+	if err != nil {
+		t.Errorf("Could not verify challenge: %s", err.Error())
+	}
+
+	if !ok || step != 0 {
+		t.Errorf("Expected an exact match at step 0, got ok=%v step=%d", ok, step)
+	}
+
+	// Shift `at` one step into the future; the challenge is now one step in
+	// the past relative to it, so it should only verify with backward drift.
+	future := at.Add(time.Duration(StepSeconds) * time.Second)
+
+	if ok, _, _ := token.VerifyChallengeAt(correctOTP, future, 0, 0); ok {
+		t.Error("Expected no match without drift tolerance")
+	}
+
+	ok, step, err = token.VerifyChallengeAt(correctOTP, future, 1, 0)
+	if err != nil {
+		t.Errorf("Could not verify challenge: %s", err.Error())
+	}
+
+	if !ok || step != -1 {
+		t.Errorf("Expected a match at step -1, got ok=%v step=%d", ok, step)
+	}
+}
+
+// Tests that GenerateHOTP matches the RFC4226 Appendix D test vectors and
+// advances the token's counter on each call.
+func TestGenerateHOTP(t *testing.T) {
+	// Secret and expected codes are taken verbatim from RFC4226 Appendix D.
+	rfcOTPs := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+
+	token, err := TokenFromBytes([]byte("12345678901234567890"))
+	if err != nil {
+		t.Errorf("Token creation failed: %s", err.Error())
+	}
+
+	for i, want := range rfcOTPs {
+		otp, err := token.GenerateHOTP()
+		if err != nil {
+			t.Errorf("Could not generate a one-time passcode: %s", err.Error())
+		}
+
+		if otp != want {
+			t.Errorf("Counter %d: generated OTP '%s' does not match test OTP '%s'", i, otp, want)
+		}
+	}
+
+	if token.Counter != int64(len(rfcOTPs)) {
+		t.Errorf("Counter did not advance as expected, got %d", token.Counter)
+	}
+}
+
+// Tests GenerateTOTP against the RFC6238 Appendix B test vectors for
+// SHA256 and SHA512, using an 8-digit code and a generation time of 59
+// seconds (T=0000000000000001).
+func TestGenerateTOTPAlgorithms(t *testing.T) {
+	cases := []struct {
+		algorithm Algorithm
+		seed      []byte
+		want      string
+	}{
+		{AlgorithmSHA1, []byte("12345678901234567890"), "94287082"},
+		{AlgorithmSHA256, []byte("12345678901234567890123456789012"), "46119246"},
+		{AlgorithmSHA512, []byte("1234567890123456789012345678901234567890123456789012345678901234"), "90693936"},
+	}
+
+	for _, c := range cases {
+		token, err := TokenFromBytes(c.seed, TokenConfig{Algorithm: c.algorithm, Digits: 8})
+		if err != nil {
+			t.Errorf("Token creation failed: %s", err.Error())
+		}
+
+		otp, err := token.GenerateTOTP(59)
+		if err != nil {
+			t.Errorf("Could not generate a one-time passcode: %s", err.Error())
+		}
+
+		if otp != c.want {
+			t.Errorf("Algorithm %d: generated OTP '%s' does not match test OTP '%s'", c.algorithm, otp, c.want)
+		}
+	}
+}
+
+// Tests that an out-of-range Digits value is rejected.
+func TestTokenConfigInvalidDigits(t *testing.T) {
+	if _, err := TokenFromBytes(testSeedBytes, TokenConfig{Digits: 9}); err == nil {
+		t.Error("Expected an error for a Digits value outside of 6-8")
+	}
+}
+
+// Tests that ProvisioningURI emits a well-formed otpauth:// TOTP URI by
+// default, and an HOTP URI with the counter query parameter when WithCounter
+// is given.
+func TestProvisioningURI(t *testing.T) {
+	token, err := TokenFromBytes(testSeedBytes)
+	if err != nil {
+		t.Errorf("Token creation failed: %s", err.Error())
+	}
+
+	totpURI := token.ProvisioningURI("Example Co", "alice@example.com")
+	wantTOTP := "otpauth://totp/Example%20Co:alice@example.com?algorithm=SHA1&digits=6&issuer=Example+Co&period=30&secret=" + token.Base32
+
+	if totpURI != wantTOTP {
+		t.Errorf("TOTP URI '%s' does not match expected '%s'", totpURI, wantTOTP)
+	}
+
+	hotpURI := token.ProvisioningURI("Example Co", "alice@example.com", WithCounter(5))
+	wantHOTP := "otpauth://hotp/Example%20Co:alice@example.com?algorithm=SHA1&counter=5&digits=6&issuer=Example+Co&secret=" + token.Base32
+
+	if hotpURI != wantHOTP {
+		t.Errorf("HOTP URI '%s' does not match expected '%s'", hotpURI, wantHOTP)
+	}
+
+	// An issuer or account name containing "/" must not split the label
+	// into multiple path segments.
+	slashURI := token.ProvisioningURI("My/Corp", "bob/example.com")
+	wantSlash := "otpauth://totp/My%2FCorp:bob%2Fexample.com?algorithm=SHA1&digits=6&issuer=My%2FCorp&period=30&secret=" + token.Base32
+
+	if slashURI != wantSlash {
+		t.Errorf("Slash-bearing URI '%s' does not match expected '%s'", slashURI, wantSlash)
+	}
+}
+
+// Tests that QR renders a non-empty PNG for a token's provisioning URI.
+func TestQR(t *testing.T) {
+	token, err := TokenFromBytes(testSeedBytes)
+	if err != nil {
+		t.Errorf("Token creation failed: %s", err.Error())
+	}
+
+	png, err := token.QR("Example Co", "alice@example.com")
+	if err != nil {
+		t.Errorf("Could not render QR code: %s", err.Error())
+	}
+
+	if len(png) == 0 {
+		t.Error("Expected non-empty PNG data")
+	}
+}
+
+// Tests that VerifyHOTP resynchronizes within the lookahead window and
+// rejects a replayed challenge once the counter has advanced past it.
+func TestVerifyHOTP(t *testing.T) {
+	token, err := TokenFromBytes([]byte("12345678901234567890"))
+	if err != nil {
+		t.Errorf("Token creation failed: %s", err.Error())
+	}
+
+	// The client is two counters ahead of the server.
+	token.Counter = 2
+	matched, ok, err := token.VerifyHOTP("338314", 3)
+	if err != nil {
+		t.Errorf("Could not verify challenge: %s", err.Error())
+	}
+
+	if !ok || matched != 4 {
+		t.Errorf("Expected a match at counter 4, got matched=%d ok=%v", matched, ok)
+	}
+
+	if token.Counter != 5 {
+		t.Errorf("Counter did not resynchronize to 5, got %d", token.Counter)
+	}
+
+	// Replaying the same challenge should now fail, since the counter moved
+	// past it.
+	if _, ok, _ := token.VerifyHOTP("338314", 3); ok {
+		t.Error("Expected replayed challenge to fail verification")
+	}
+}
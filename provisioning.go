@@ -0,0 +1,104 @@
+package gotp
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"rsc.io/qr"
+)
+
+// ProvisioningOption customizes the otpauth:// URI produced by
+// ProvisioningURI.
+type ProvisioningOption func(*provisioningParams)
+
+// provisioningParams holds the otpauth:// fields that vary between TOTP and
+// HOTP tokens.
+type provisioningParams struct {
+	hotp    bool
+	counter int64
+	period  int
+}
+
+// WithCounter marks the provisioning URI as HOTP and sets its initial
+// counter value. Without this option, ProvisioningURI emits a TOTP URI.
+func WithCounter(counter int64) ProvisioningOption {
+	return func(p *provisioningParams) {
+		p.hotp = true
+		p.counter = counter
+	}
+}
+
+// WithPeriod overrides the TOTP period advertised in the URI. It has no
+// effect when combined with WithCounter. Defaults to StepSeconds.
+func WithPeriod(period int) ProvisioningOption {
+	return func(p *provisioningParams) {
+		p.period = period
+	}
+}
+
+// algorithmName returns the otpauth:// "algorithm" parameter value for a.
+func algorithmName(a Algorithm) string {
+	switch a {
+	case AlgorithmSHA256:
+		return "SHA256"
+	case AlgorithmSHA512:
+		return "SHA512"
+	default:
+		return "SHA1"
+	}
+}
+
+// ProvisioningURI builds a Key Uri Format string
+// (https://github.com/google/google-authenticator/wiki/Key-Uri-Format)
+// suitable for Google Authenticator, Authy, 1Password, and similar apps to
+// scan or import. By default it describes a TOTP token; pass WithCounter to
+// describe an HOTP token instead.
+func (t *Token) ProvisioningURI(issuer, accountName string, opts ...ProvisioningOption) string {
+	params := provisioningParams{period: StepSeconds}
+	for _, opt := range opts {
+		opt(&params)
+	}
+
+	digits := t.Digits
+	if digits == 0 {
+		digits = TokenLength
+	}
+
+	scheme := "totp"
+	if params.hotp {
+		scheme = "hotp"
+	}
+
+	// The label must be a single path segment - url.PathEscape escapes "/"
+	// (unlike assigning to url.URL.Path, which only escapes what's invalid
+	// in a path and would let a "/" in issuer or accountName split it into
+	// two segments).
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(accountName)
+
+	q := url.Values{}
+	q.Set("secret", t.Base32)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", algorithmName(t.Algorithm))
+	q.Set("digits", strconv.Itoa(digits))
+
+	if params.hotp {
+		q.Set("counter", strconv.FormatInt(params.counter, 10))
+	} else {
+		q.Set("period", strconv.Itoa(params.period))
+	}
+
+	return fmt.Sprintf("otpauth://%s/%s?%s", scheme, label, q.Encode())
+}
+
+// QR renders the token's provisioning URI as a QR code PNG, ready to be
+// displayed for enrollment in an authenticator app. See ProvisioningURI for
+// the meaning of issuer, accountName and opts.
+func (t *Token) QR(issuer, accountName string, opts ...ProvisioningOption) ([]byte, error) {
+	code, err := qr.Encode(t.ProvisioningURI(issuer, accountName, opts...), qr.M)
+	if err != nil {
+		return nil, err
+	}
+
+	return code.PNG(), nil
+}
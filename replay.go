@@ -0,0 +1,57 @@
+package gotp
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrReplay is returned by VerifyChallengeAt when a ReplayGuard is
+// configured and the matched OTP's time-step is not later than the last
+// time-step recorded for the token.
+var ErrReplay = errors.New("gotp: challenge has already been used")
+
+// ReplayGuard records the last verified TOTP time-step for a token, so a
+// previously accepted OTP cannot be replayed while it remains otherwise
+// valid within its drift window. Implementations are expected to be safe
+// for concurrent use; to share replay state across multiple servers, back
+// ReplayGuard with Redis, SQL, or another shared store instead of
+// MemoryReplayGuard.
+type ReplayGuard interface {
+	// LastStep returns the last time-step successfully verified for
+	// tokenID, or 0 if none has been recorded yet.
+	LastStep(tokenID string) (int64, error)
+	// SetLastStep records step as the last time-step successfully verified
+	// for tokenID.
+	SetLastStep(tokenID string, step int64) error
+}
+
+// MemoryReplayGuard is a ReplayGuard backed by an in-memory map. It is only
+// suitable for a single process; state is lost on restart and is not
+// shared across replicas.
+type MemoryReplayGuard struct {
+	mu    sync.Mutex
+	steps map[string]int64
+}
+
+// NewMemoryReplayGuard creates an empty MemoryReplayGuard.
+func NewMemoryReplayGuard() *MemoryReplayGuard {
+	return &MemoryReplayGuard{steps: make(map[string]int64)}
+}
+
+// LastStep implements ReplayGuard.
+func (g *MemoryReplayGuard) LastStep(tokenID string) (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.steps[tokenID], nil
+}
+
+// SetLastStep implements ReplayGuard.
+func (g *MemoryReplayGuard) SetLastStep(tokenID string, step int64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.steps[tokenID] = step
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package gotp
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that MemoryReplayGuard starts every token at step 0 and records
+// whatever is set.
+func TestMemoryReplayGuard(t *testing.T) {
+	guard := NewMemoryReplayGuard()
+
+	step, err := guard.LastStep("token-a")
+	if err != nil {
+		t.Errorf("Could not read last step: %s", err.Error())
+	}
+
+	if step != 0 {
+		t.Errorf("Expected an unseen token to start at step 0, got %d", step)
+	}
+
+	if err := guard.SetLastStep("token-a", 42); err != nil {
+		t.Errorf("Could not set last step: %s", err.Error())
+	}
+
+	step, err = guard.LastStep("token-a")
+	if err != nil {
+		t.Errorf("Could not read last step: %s", err.Error())
+	}
+
+	if step != 42 {
+		t.Errorf("Expected last step 42, got %d", step)
+	}
+}
+
+// Tests that a Token configured with a ReplayGuard rejects a replayed OTP,
+// but still accepts a later, distinct one.
+func TestVerifyChallengeAtReplayGuard(t *testing.T) {
+	token, err := TokenFromBytes(testSeedBytes)
+	if err != nil {
+		t.Errorf("Token creation failed: %s", err.Error())
+	}
+
+	token.ID = "user-1"
+	token.ReplayGuard = NewMemoryReplayGuard()
+
+	at := time.Unix(testTime, 0)
+
+	otp, err := token.GenerateTOTP(testTime)
+	if err != nil {
+		t.Errorf("Could not generate a one-time passcode: %s", err.Error())
+	}
+
+	ok, _, err := token.VerifyChallengeAt(otp, at, 0, 0)
+	if err != nil {
+		t.Errorf("Could not verify challenge: %s", err.Error())
+	}
+
+	if !ok {
+		t.Error("Expected first use of the challenge to verify")
+	}
+
+	ok, _, err = token.VerifyChallengeAt(otp, at, 0, 0)
+	if err != ErrReplay {
+		t.Errorf("Expected ErrReplay on reuse, got ok=%v err=%v", ok, err)
+	}
+
+	// A code from a later step should still verify.
+	future := at.Add(time.Duration(StepSeconds) * time.Second)
+
+	otp, err = token.GenerateTOTP(future.Unix())
+	if err != nil {
+		t.Errorf("Could not generate a one-time passcode: %s", err.Error())
+	}
+
+	ok, _, err = token.VerifyChallengeAt(otp, future, 0, 0)
+	if err != nil {
+		t.Errorf("Could not verify challenge: %s", err.Error())
+	}
+
+	if !ok {
+		t.Error("Expected a later, distinct challenge to verify")
+	}
+}